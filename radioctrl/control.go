@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultControlSocket is where the daemon listens for `-send` commands from
+// other invocations of this binary, so keyboard bindings (sway/i3, etc.) can
+// script the running instance without going through HTTP.
+const defaultControlSocket = "/tmp/radioctr.sock"
+
+// shutdownChan is closed to ask the running daemon to exit, e.g. when a new
+// instance starts with -replace and takes over the control socket.
+// shutdownOnce guards the close, since concurrent "quit" commands on
+// separate control-socket connections would otherwise double-close it.
+var (
+	shutdownChan = make(chan struct{})
+	shutdownOnce sync.Once
+)
+
+// acquireControlSocket binds path as the single-instance control socket. If
+// another instance already holds it, acquireControlSocket either errors out
+// or, when replace is true, asks it to shut down and takes over - this is
+// what keeps two mpv processes from ever fighting over the mpv IPC socket.
+func acquireControlSocket(path string, replace bool) (net.Listener, error) {
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		conn.Close()
+		if !replace {
+			return nil, fmt.Errorf("another radioctr instance is already listening on %s (use -replace to take over)", path)
+		}
+		log.Printf("Asking existing instance on %s to shut down\n", path)
+		if err := sendControlCommand(path, "quit"); err != nil {
+			log.Printf("Warning: couldn't ask existing instance to quit: %v", err)
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+
+	os.Remove(path)
+	return net.Listen("unix", path)
+}
+
+// runControlServer accepts connections on l, handling one command per
+// connection, until l is closed.
+func runControlServer(l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go handleControlConn(conn)
+	}
+}
+
+func handleControlConn(conn net.Conn) {
+	defer conn.Close()
+
+	scanner := bufio.NewScanner(conn)
+	if !scanner.Scan() {
+		return
+	}
+	fmt.Fprintln(conn, dispatchControlCommand(strings.TrimSpace(scanner.Text())))
+}
+
+// dispatchControlCommand runs a single -send subcommand against the daemon's
+// existing control functions, the same ones the HTTP and gamepad paths use.
+func dispatchControlCommand(cmd string) string {
+	switch cmd {
+	case "next":
+		if err := PlayNextStation(); err != nil {
+			return "error: " + err.Error()
+		}
+		return "ok: " + playbackServer.Default().Station().Name
+	case "prev":
+		if err := PlayPrevStation(); err != nil {
+			return "error: " + err.Error()
+		}
+		return "ok: " + playbackServer.Default().Station().Name
+	case "toggle":
+		client := playbackServer.Default().Client()
+		if client == nil {
+			return "error: mpv is not running"
+		}
+		if _, err := client.Command("cycle", "pause"); err != nil {
+			return "error: " + err.Error()
+		}
+		return "ok"
+	case "stop":
+		if err := StopPlayer(); err != nil {
+			return "error: " + err.Error()
+		}
+		return "ok"
+	case "volup":
+		if err := AdjustVolume(10); err != nil {
+			return "error: " + err.Error()
+		}
+		return fmt.Sprintf("ok: volume %d", playbackServer.Default().Volume())
+	case "voldown":
+		if err := AdjustVolume(-10); err != nil {
+			return "error: " + err.Error()
+		}
+		return fmt.Sprintf("ok: volume %d", playbackServer.Default().Volume())
+	case "list":
+		current := getStations()
+		names := make([]string, len(current))
+		for i, s := range current {
+			names[i] = s.Name
+		}
+		return strings.Join(names, "; ")
+	case "status":
+		return fmt.Sprintf("ok: station=%s volume=%d", playbackServer.Default().Station().Name, playbackServer.Default().Volume())
+	case "quit":
+		shutdownOnce.Do(func() { close(shutdownChan) })
+		return "ok: shutting down"
+	default:
+		return "error: unknown command " + cmd
+	}
+}
+
+// sendControlCommand connects to the control socket at path, sends cmd, and
+// prints the daemon's reply. It's used both by `radioctr -send ...` and by a
+// new instance asking an old one (via -replace) to step aside.
+func sendControlCommand(path, cmd string) error {
+	conn, err := net.DialTimeout("unix", path, time.Second)
+	if err != nil {
+		return fmt.Errorf("failed to connect to control socket: %v", err)
+	}
+	defer conn.Close()
+
+	if _, err := fmt.Fprintln(conn, cmd); err != nil {
+		return fmt.Errorf("failed to send command: %v", err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	reply, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil && reply == "" {
+		return fmt.Errorf("failed to read reply: %v", err)
+	}
+
+	fmt.Print(reply)
+	return nil
+}
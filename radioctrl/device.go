@@ -0,0 +1,434 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// DeviceConfig describes one playback zone: its own mpv process, output
+// sink, and tuning state, similar to a Navidrome jukebox device.
+type DeviceConfig struct {
+	Name        string `json:"name"`
+	AudioDevice string `json:"audio_device"`
+	Default     bool   `json:"default"`
+}
+
+// PlaybackDevice is one mpv process with its own IPC socket, station index,
+// volume, gain, and mute state.
+type PlaybackDevice struct {
+	Name        string
+	AudioDevice string
+	IsDefault   bool
+	socketPath  string
+
+	mu         sync.Mutex
+	cmd        *exec.Cmd
+	client     *MPVClient
+	currentIdx int
+	currentVol int
+	gain       float64
+	muted      bool
+	listenID   int64
+}
+
+// newPlaybackDevice builds a device with sane defaults: half volume, unity
+// gain, unmuted, tuned to the first station.
+func newPlaybackDevice(cfg DeviceConfig, socketPath string) *PlaybackDevice {
+	return &PlaybackDevice{
+		Name:        cfg.Name,
+		AudioDevice: cfg.AudioDevice,
+		IsDefault:   cfg.Default,
+		socketPath:  socketPath,
+		currentVol:  50,
+		gain:        1.0,
+		listenID:    -1,
+	}
+}
+
+// Client returns the device's current mpv IPC client, or nil if mpv isn't
+// running on it.
+func (d *PlaybackDevice) Client() *MPVClient {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.client
+}
+
+// Station returns the station this device is currently tuned to.
+func (d *PlaybackDevice) Station() RadioStation {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return getStations()[d.currentIdx]
+}
+
+// clampIndex pulls currentIdx back inside [0, n) if a station refresh
+// shrank the list out from under it.
+func (d *PlaybackDevice) clampIndex(n int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if n > 0 && d.currentIdx >= n {
+		d.currentIdx = n - 1
+	}
+}
+
+// Volume returns the device's current volume (0-100), before gain/mute.
+func (d *PlaybackDevice) Volume() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.currentVol
+}
+
+// Gain returns the device's volume multiplier.
+func (d *PlaybackDevice) Gain() float64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.gain
+}
+
+// Muted reports whether the device is currently muted.
+func (d *PlaybackDevice) Muted() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.muted
+}
+
+// effectiveVolumeLocked applies gain and mute on top of currentVol to get
+// the value actually sent to mpv. Caller must hold d.mu.
+func (d *PlaybackDevice) effectiveVolumeLocked() int {
+	if d.muted {
+		return 0
+	}
+	eff := int(float64(d.currentVol) * d.gain)
+	if eff < 0 {
+		eff = 0
+	} else if eff > 100 {
+		eff = 100
+	}
+	return eff
+}
+
+// Start launches (or relaunches) mpv for this device against url.
+func (d *PlaybackDevice) Start(url string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.startLocked(url)
+}
+
+func (d *PlaybackDevice) startLocked(url string) error {
+	if d.client != nil {
+		d.client.OnDisconnect = nil // this teardown is intentional, not a stream failure
+		d.client.Close()
+		d.client = nil
+	}
+	if d.cmd != nil && d.cmd.Process != nil {
+		d.cmd.Process.Kill()
+		d.cmd.Wait()
+	}
+
+	os.Remove(d.socketPath)
+
+	args := []string{"--no-video", "--idle=yes", fmt.Sprintf("--input-ipc-server=%s", d.socketPath)}
+	if d.AudioDevice != "" {
+		args = append(args, fmt.Sprintf("--audio-device=%s", d.AudioDevice))
+	}
+	args = append(args, url)
+
+	d.cmd = exec.Command("mpv", args...)
+	if err := d.cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start mpv for device %s: %v", d.Name, err)
+	}
+
+	onDisconnect := func() { go d.retryCurrent() }
+	var client *MPVClient
+	for i := 0; i < 50; i++ {
+		if c, err := DialMPV(d.socketPath, d.onMPVEvent, onDisconnect); err == nil {
+			client = c
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if client == nil {
+		return fmt.Errorf("failed to connect to mpv IPC socket for device %s", d.Name)
+	}
+	d.client = client
+
+	if err := d.client.WaitForEvent("playback-restart", 10*time.Second); err != nil {
+		log.Printf("[%s] Warning: %v\n", d.Name, err)
+	}
+
+	if _, err := d.client.Command("set_property", "volume", d.effectiveVolumeLocked()); err != nil {
+		log.Printf("[%s] Warning: couldn't set initial volume: %v\n", d.Name, err)
+	}
+
+	d.recordListenStart(getStations()[d.currentIdx])
+
+	return nil
+}
+
+// retryCurrent re-launches mpv for this device's current station after the
+// IPC connection drops unexpectedly, so a flaky stream doesn't leave mpv
+// idle forever.
+func (d *PlaybackDevice) retryCurrent() {
+	d.mu.Lock()
+	url := getStations()[d.currentIdx].URL
+	d.mu.Unlock()
+
+	log.Printf("[%s] mpv IPC connection lost, retrying current station\n", d.Name)
+	if err := d.Start(url); err != nil {
+		log.Printf("[%s] Warning: failed to restart mpv after disconnect: %v\n", d.Name, err)
+	}
+}
+
+// Next switches this device to the next station in the shared list.
+func (d *PlaybackDevice) Next() error {
+	current := getStations()
+	d.mu.Lock()
+	d.currentIdx = (d.currentIdx + 1) % len(current)
+	name, url := current[d.currentIdx].Name, current[d.currentIdx].URL
+	d.mu.Unlock()
+
+	log.Printf("[%s] Playing next station: %s\n", d.Name, name)
+	err := d.Start(url)
+	if d.IsDefault {
+		mprisNotifyStationChanged(err == nil)
+	}
+	return err
+}
+
+// Prev switches this device to the previous station in the shared list.
+func (d *PlaybackDevice) Prev() error {
+	current := getStations()
+	d.mu.Lock()
+	d.currentIdx = (d.currentIdx - 1 + len(current)) % len(current)
+	name, url := current[d.currentIdx].Name, current[d.currentIdx].URL
+	d.mu.Unlock()
+
+	log.Printf("[%s] Playing previous station: %s\n", d.Name, name)
+	err := d.Start(url)
+	if d.IsDefault {
+		mprisNotifyStationChanged(err == nil)
+	}
+	return err
+}
+
+// AdjustVolume changes this device's volume by a given delta.
+func (d *PlaybackDevice) AdjustVolume(delta int) error {
+	d.mu.Lock()
+	d.currentVol += delta
+	if d.currentVol < 0 {
+		d.currentVol = 0
+	} else if d.currentVol > 100 {
+		d.currentVol = 100
+	}
+	eff, client := d.effectiveVolumeLocked(), d.client
+	d.mu.Unlock()
+
+	if d.IsDefault {
+		mprisNotifyVolumeChanged()
+	}
+	if client == nil {
+		return fmt.Errorf("mpv is not running for device %s", d.Name)
+	}
+	_, err := client.Command("set_property", "volume", eff)
+	return err
+}
+
+// SetVolume sets this device's volume to an absolute level (0-100).
+func (d *PlaybackDevice) SetVolume(level int) error {
+	d.mu.Lock()
+	if level < 0 {
+		level = 0
+	} else if level > 100 {
+		level = 100
+	}
+	d.currentVol = level
+	eff, client := d.effectiveVolumeLocked(), d.client
+	d.mu.Unlock()
+
+	if d.IsDefault {
+		mprisNotifyVolumeChanged()
+	}
+	if client == nil {
+		return fmt.Errorf("mpv is not running for device %s", d.Name)
+	}
+	_, err := client.Command("set_property", "volume", eff)
+	return err
+}
+
+// SetGain sets this device's volume multiplier, applied on top of Volume.
+func (d *PlaybackDevice) SetGain(gain float64) error {
+	d.mu.Lock()
+	d.gain = gain
+	eff, client := d.effectiveVolumeLocked(), d.client
+	d.mu.Unlock()
+
+	if client == nil {
+		return fmt.Errorf("mpv is not running for device %s", d.Name)
+	}
+	_, err := client.Command("set_property", "volume", eff)
+	return err
+}
+
+// SetMuted mutes or unmutes this device.
+func (d *PlaybackDevice) SetMuted(muted bool) error {
+	d.mu.Lock()
+	d.muted = muted
+	eff, client := d.effectiveVolumeLocked(), d.client
+	d.mu.Unlock()
+
+	if client == nil {
+		return fmt.Errorf("mpv is not running for device %s", d.Name)
+	}
+	_, err := client.Command("set_property", "volume", eff)
+	return err
+}
+
+// Stop stops playback on this device.
+func (d *PlaybackDevice) Stop() error {
+	d.mu.Lock()
+	client := d.client
+	d.mu.Unlock()
+
+	if client == nil {
+		return fmt.Errorf("mpv is not running for device %s", d.Name)
+	}
+	log.Printf("[%s] Stopping playback\n", d.Name)
+	_, err := client.Command("stop")
+	d.recordListenEnd()
+	if d.IsDefault && mprisProps != nil {
+		mprisProps.SetMust(mprisPlayerIface, "PlaybackStatus", "Stopped")
+	}
+	return err
+}
+
+// Shutdown kills this device's mpv process and cleans up its socket; used
+// when the daemon exits so mpv is never left orphaned.
+func (d *PlaybackDevice) Shutdown() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.client != nil {
+		d.client.OnDisconnect = nil
+		d.client.Close()
+		d.client = nil
+	}
+	if d.cmd != nil && d.cmd.Process != nil {
+		d.cmd.Process.Kill()
+		d.cmd.Wait()
+	}
+	os.Remove(d.socketPath)
+}
+
+// recordListenStart closes out the device's previous listening session (if
+// any) and opens a new one. If station came from radio-browser.info, it
+// also registers a click - this is the one place a station is actually
+// being tuned into, as opposed to merely listed by a directory query.
+func (d *PlaybackDevice) recordListenStart(station RadioStation) {
+	if station.StationUUID != "" {
+		go registerRadioBrowserClick(station.StationUUID)
+	}
+
+	if statsStore == nil {
+		return
+	}
+	now := time.Now()
+	if d.listenID != -1 {
+		if err := statsStore.EndListen(d.listenID, now); err != nil {
+			log.Printf("[%s] Warning: couldn't record listen end: %v\n", d.Name, err)
+		}
+	}
+	id, err := statsStore.StartListen(station.Name, station.URL, now)
+	if err != nil {
+		log.Printf("[%s] Warning: couldn't record listen start: %v\n", d.Name, err)
+		return
+	}
+	d.listenID = id
+}
+
+// recordListenEnd closes out the device's current listening session, if any.
+func (d *PlaybackDevice) recordListenEnd() {
+	if statsStore == nil || d.listenID == -1 {
+		return
+	}
+	if err := statsStore.EndListen(d.listenID, time.Now()); err != nil {
+		log.Printf("[%s] Warning: couldn't record listen end: %v\n", d.Name, err)
+	}
+	d.listenID = -1
+}
+
+// PlaybackServer owns every configured PlaybackDevice, keyed by name.
+type PlaybackServer struct {
+	mu          sync.RWMutex
+	devices     map[string]*PlaybackDevice
+	defaultName string
+}
+
+// NewPlaybackServer returns an empty PlaybackServer; call Add to register
+// devices before using Default/Get.
+func NewPlaybackServer() *PlaybackServer {
+	return &PlaybackServer{devices: make(map[string]*PlaybackDevice)}
+}
+
+// Add registers a device. The first device added, or the one whose config
+// set Default, becomes the default device used by the single-zone HTTP,
+// gamepad, MPRIS, and control-socket paths.
+func (s *PlaybackServer) Add(d *PlaybackDevice) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.devices[d.Name] = d
+	if d.IsDefault || s.defaultName == "" {
+		s.defaultName = d.Name
+	}
+}
+
+// Get returns the named device, if any.
+func (s *PlaybackServer) Get(name string) (*PlaybackDevice, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	d, ok := s.devices[name]
+	return d, ok
+}
+
+// Default returns the default device.
+func (s *PlaybackServer) Default() *PlaybackDevice {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.devices[s.defaultName]
+}
+
+// All returns every registered device.
+func (s *PlaybackServer) All() []*PlaybackDevice {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	all := make([]*PlaybackDevice, 0, len(s.devices))
+	for _, d := range s.devices {
+		all = append(all, d)
+	}
+	return all
+}
+
+// Shutdown tears down every device's mpv process; called from main's
+// SIGINT/SIGTERM handler so mpv is never left orphaned.
+func (s *PlaybackServer) Shutdown() {
+	for _, d := range s.All() {
+		d.Shutdown()
+	}
+}
+
+// ClampIndices re-clamps every device's currentIdx to the new station
+// count; called after setStations swaps in a shorter list so a device
+// tuned near the old end doesn't index past the new one.
+func (s *PlaybackServer) ClampIndices(n int) {
+	for _, d := range s.All() {
+		d.clampIndex(n)
+	}
+}
+
+// deviceSocketPath returns the mpv IPC socket path for a named device that
+// wasn't given an explicit one.
+func deviceSocketPath(name string) string {
+	return fmt.Sprintf("/tmp/mpv-%s.sock", name)
+}
@@ -0,0 +1,134 @@
+// Package stats persists radioctr's listening history to a SQLite database
+// so users get a real play history instead of only current status.
+package stats
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// Store is a handle to the stats SQLite database. It is safe for concurrent
+// use by multiple goroutines.
+type Store struct {
+	db *sql.DB
+}
+
+// Listen represents one station switch: when it started, and when playback
+// moved on to something else (zero value if still playing).
+type Listen struct {
+	ID        int64      `json:"id"`
+	Station   string     `json:"station"`
+	URL       string     `json:"url"`
+	StartedAt time.Time  `json:"started_at"`
+	EndedAt   *time.Time `json:"ended_at,omitempty"`
+}
+
+// TopStation summarizes how often and how long a station has been played.
+type TopStation struct {
+	Station string `json:"station"`
+	Plays   int    `json:"plays"`
+	Seconds int64  `json:"seconds"`
+}
+
+const schema = `
+CREATE TABLE IF NOT EXISTS listens (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	station TEXT NOT NULL,
+	url TEXT NOT NULL,
+	started_at DATETIME NOT NULL,
+	ended_at DATETIME
+);`
+
+// Open opens (creating if necessary) the SQLite database at path and ensures
+// the schema exists.
+func Open(path string) (*Store, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening stats database: %v", err)
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error connecting to stats database: %v", err)
+	}
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error creating stats schema: %v", err)
+	}
+	return &Store{db: db}, nil
+}
+
+// Close releases the underlying database handle.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// StartListen records the start of a new listening session and returns its
+// ID. Pass the ID to EndListen once playback moves on to another station.
+func (s *Store) StartListen(station, url string, startedAt time.Time) (int64, error) {
+	res, err := s.db.Exec(`INSERT INTO listens (station, url, started_at) VALUES (?, ?, ?)`, station, url, startedAt)
+	if err != nil {
+		return 0, fmt.Errorf("error recording listen start: %v", err)
+	}
+	return res.LastInsertId()
+}
+
+// EndListen records when a previously started listening session ended.
+func (s *Store) EndListen(id int64, endedAt time.Time) error {
+	if _, err := s.db.Exec(`UPDATE listens SET ended_at = ? WHERE id = ?`, endedAt, id); err != nil {
+		return fmt.Errorf("error recording listen end: %v", err)
+	}
+	return nil
+}
+
+// History returns the last limit tuned stations, most recent first.
+func (s *Store) History(limit int) ([]Listen, error) {
+	rows, err := s.db.Query(`SELECT id, station, url, started_at, ended_at FROM listens ORDER BY started_at DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error querying history: %v", err)
+	}
+	defer rows.Close()
+
+	history := []Listen{}
+	for rows.Next() {
+		var l Listen
+		var endedAt sql.NullTime
+		if err := rows.Scan(&l.ID, &l.Station, &l.URL, &l.StartedAt, &endedAt); err != nil {
+			return nil, fmt.Errorf("error scanning history row: %v", err)
+		}
+		if endedAt.Valid {
+			l.EndedAt = &endedAt.Time
+		}
+		history = append(history, l)
+	}
+	return history, rows.Err()
+}
+
+// TopStations returns stations played since the given time, most-played
+// first.
+func (s *Store) TopStations(since time.Time) ([]TopStation, error) {
+	rows, err := s.db.Query(`
+		SELECT station,
+		       COUNT(*) AS plays,
+		       COALESCE(SUM(CAST(strftime('%s', COALESCE(ended_at, started_at)) AS INTEGER) - CAST(strftime('%s', started_at) AS INTEGER)), 0) AS seconds
+		FROM listens
+		WHERE started_at >= ?
+		GROUP BY station
+		ORDER BY plays DESC`, since)
+	if err != nil {
+		return nil, fmt.Errorf("error querying top stations: %v", err)
+	}
+	defer rows.Close()
+
+	top := []TopStation{}
+	for rows.Next() {
+		var t TopStation
+		if err := rows.Scan(&t.Station, &t.Plays, &t.Seconds); err != nil {
+			return nil, fmt.Errorf("error scanning top station row: %v", err)
+		}
+		top = append(top, t)
+	}
+	return top, rows.Err()
+}
@@ -0,0 +1,85 @@
+package stats
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func openTestStore(t *testing.T) *Store {
+	t.Helper()
+	s, err := Open(filepath.Join(t.TempDir(), "stats.db"))
+	if err != nil {
+		t.Fatalf("Open returned error: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestStartAndEndListen(t *testing.T) {
+	s := openTestStore(t)
+
+	start := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+	id, err := s.StartListen("Station One", "http://example.com/one.mp3", start)
+	if err != nil {
+		t.Fatalf("StartListen returned error: %v", err)
+	}
+
+	history, err := s.History(10)
+	if err != nil {
+		t.Fatalf("History returned error: %v", err)
+	}
+	if len(history) != 1 {
+		t.Fatalf("got %d history entries, want 1: %+v", len(history), history)
+	}
+	if history[0].EndedAt != nil {
+		t.Errorf("EndedAt = %v, want nil before EndListen", history[0].EndedAt)
+	}
+
+	end := start.Add(30 * time.Minute)
+	if err := s.EndListen(id, end); err != nil {
+		t.Fatalf("EndListen returned error: %v", err)
+	}
+
+	history, err = s.History(10)
+	if err != nil {
+		t.Fatalf("History returned error: %v", err)
+	}
+	if history[0].EndedAt == nil {
+		t.Fatal("EndedAt is nil after EndListen")
+	}
+}
+
+func TestTopStations(t *testing.T) {
+	s := openTestStore(t)
+
+	now := time.Now().UTC().Truncate(time.Second)
+	plays := []struct {
+		station  string
+		duration time.Duration
+	}{
+		{"Station One", 10 * time.Minute},
+		{"Station One", 5 * time.Minute},
+		{"Station Two", 1 * time.Minute},
+	}
+	for _, p := range plays {
+		id, err := s.StartListen(p.station, "http://example.com/"+p.station, now)
+		if err != nil {
+			t.Fatalf("StartListen returned error: %v", err)
+		}
+		if err := s.EndListen(id, now.Add(p.duration)); err != nil {
+			t.Fatalf("EndListen returned error: %v", err)
+		}
+	}
+
+	top, err := s.TopStations(now.Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("TopStations returned error: %v", err)
+	}
+	if len(top) != 2 {
+		t.Fatalf("got %d top stations, want 2: %+v", len(top), top)
+	}
+	if top[0].Station != "Station One" || top[0].Plays != 2 {
+		t.Errorf("top[0] = %+v, want Station One with 2 plays", top[0])
+	}
+}
@@ -10,25 +10,30 @@ import (
 	"io"
 	"io/ioutil"
 	"log"
-	"net"
 	"net/http"
 	"os"
-	"os/exec"
 	"os/signal"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
+
+	"radioctrl/internal/stats"
 )
 
 // Config represents the application configuration
 type Config struct {
-	ServerPort     string       `json:"server_port"`
-	GamepadDevice  string       `json:"gamepad_device"`
-	StationsAPIURL string       `json:"stations_api_url"`
-	ButtonMappings ButtonConfig `json:"button_mappings"`
+	ServerPort     string         `json:"server_port"`
+	GamepadDevice  string         `json:"gamepad_device"`
+	StationsAPIURL string         `json:"stations_api_url"`
+	ButtonMappings ButtonConfig   `json:"button_mappings"`
+	StatsDBPath    string         `json:"stats_db_path"`
+	Devices        []DeviceConfig `json:"devices"`
+	StationSources []SourceSpec   `json:"station_sources"`
 }
 
 // ButtonConfig maps button numbers to actions
@@ -41,10 +46,13 @@ type ButtonConfig struct {
 	VolumeDown uint8 `json:"volume_down"`
 }
 
-// RadioStation represents a radio station with its name and stream URL
+// RadioStation represents a radio station with its name and stream URL.
+// StationUUID is set only for stations sourced from radio-browser.info, so
+// PlaybackDevice can register a click when one is actually tuned into.
 type RadioStation struct {
-	Name string `json:"name"`
-	URL  string `json:"url"`
+	Name        string `json:"name"`
+	URL         string `json:"url"`
+	StationUUID string `json:"station_uuid,omitempty"`
 }
 
 // JoystickEvent represents the structure of a joystick input event
@@ -56,16 +64,41 @@ type JoystickEvent struct {
 }
 
 var (
-	mpvCmd     *exec.Cmd
-	mpvMutex   sync.Mutex
 	stations   []RadioStation
-	currentIdx int
-	currentVol int = 50
-	config     Config
-	mpvSocket  string = "/tmp/mpv-socket"
-	version    string = "1.0.0"
+	stationsMu sync.RWMutex
+
+	config         Config
+	version        string = "1.0.0"
+	statsStore     *stats.Store
+	playbackServer = NewPlaybackServer()
+
+	clientsMutex sync.Mutex
+	clientSeen   = map[string]time.Time{}
 )
 
+// getStations returns the current station list. Devices and HTTP handlers
+// must go through this (never read the stations var directly) since
+// /stations/refresh can swap it out from under them at any time.
+func getStations() []RadioStation {
+	stationsMu.RLock()
+	defer stationsMu.RUnlock()
+	return stations
+}
+
+// setStations swaps in a freshly loaded station list and clamps every
+// device's currentIdx so a refresh that shrinks the list can't leave a
+// device pointing past the end of it.
+func setStations(newStations []RadioStation) {
+	stationsMu.Lock()
+	stations = newStations
+	stationsMu.Unlock()
+	playbackServer.ClampIndices(len(newStations))
+}
+
+// clientWindow is how long an HTTP client is considered an active listener
+// after its last request.
+const clientWindow = 5 * time.Minute
+
 // DefaultConfig returns the default configuration
 func DefaultConfig() Config {
 	return Config{
@@ -80,6 +113,8 @@ func DefaultConfig() Config {
 			VolumeDown: 6,
 			VolumeUp:   7,
 		},
+		StatsDBPath: filepath.Join(os.Getenv("HOME"), ".config", "radiopad", "stats.db"),
+		Devices:     []DeviceConfig{{Name: "default", Default: true}},
 	}
 }
 
@@ -149,103 +184,54 @@ func FetchRadioStations(apiURL string) ([]RadioStation, error) {
 	return fetchedStations, nil
 }
 
-// SendMPVCommand sends a command to the running mpv process via Unix domain socket
-func SendMPVCommand(command string) error {
-	// Ensure command ends with newline
-	if command[len(command)-1] != '\n' {
-		command += "\n"
-	}
-
-	// Connect to MPV's Unix domain socket
-	conn, err := net.Dial("unix", mpvSocket)
-	if err != nil {
-		return fmt.Errorf("failed to connect to MPV socket: %v", err)
-	}
-	defer conn.Close()
-
-	// Write command to socket
-	if _, err := conn.Write([]byte(command)); err != nil {
-		return fmt.Errorf("failed to write to MPV socket: %v", err)
-	}
-
-	// Read response
-	response := make([]byte, 1024)
-	_, err = conn.Read(response)
-	if err != nil && err != io.EOF {
-		log.Printf("Warning: couldn't read MPV response: %v", err)
-	}
-
-	return nil
-}
-
-// StartMPV starts the mpv process with the given stream URL
+// StartMPV starts playback of url on the default playback device. Multi-zone
+// setups should use the /devices/:name routes instead.
 func StartMPV(url string) error {
-	mpvMutex.Lock()
-	defer mpvMutex.Unlock()
-
-	// Kill existing mpv process if it's running
-	if mpvCmd != nil && mpvCmd.Process != nil {
-		mpvCmd.Process.Kill()
-		mpvCmd.Wait()
-	}
-
-	// Remove existing socket if it exists
-	os.Remove(mpvSocket)
-
-	// Start a new mpv process
-	mpvCmd = exec.Command("mpv", "--no-video", "--idle=yes", fmt.Sprintf("--input-ipc-server=%s", mpvSocket), url)
-	if err := mpvCmd.Start(); err != nil {
-		return fmt.Errorf("failed to start mpv: %v", err)
-	}
-
-	// Wait for socket to be created
-	for i := 0; i < 50; i++ {
-		if _, err := os.Stat(mpvSocket); err == nil {
-			break
-		}
-		time.Sleep(100 * time.Millisecond)
-	}
-
-	// Set initial volume
-	time.Sleep(500 * time.Millisecond)
-	if err := AdjustVolume(0); err != nil {
-		log.Printf("Warning: couldn't set initial volume: %v", err)
-	}
-
-	return nil
+	return playbackServer.Default().Start(url)
 }
 
-// PlayNextStation switches to the next station in the list
+// PlayNextStation switches the default device to the next station in the list.
 func PlayNextStation() error {
-	currentIdx = (currentIdx + 1) % len(stations)
-	log.Printf("Playing next station: %s\n", stations[currentIdx].Name)
-	return StartMPV(stations[currentIdx].URL)
+	return playbackServer.Default().Next()
 }
 
-// PlayPrevStation switches to the previous station in the list
+// PlayPrevStation switches the default device to the previous station in the list.
 func PlayPrevStation() error {
-	currentIdx = (currentIdx - 1 + len(stations)) % len(stations)
-	log.Printf("Playing previous station: %s\n", stations[currentIdx].Name)
-	return StartMPV(stations[currentIdx].URL)
+	return playbackServer.Default().Prev()
 }
 
-// AdjustVolume changes the volume by a given delta
+// AdjustVolume changes the default device's volume by a given delta.
 func AdjustVolume(delta int) error {
-	currentVol += delta
-	if currentVol < 0 {
-		currentVol = 0
-	} else if currentVol > 100 {
-		currentVol = 100
-	}
-
-	command := fmt.Sprintf(`{ "command": ["set_property", "volume", %d] }`, currentVol)
-	return SendMPVCommand(command)
+	return playbackServer.Default().AdjustVolume(delta)
 }
 
-// StopPlayer sends the stop command to MPV
+// StopPlayer stops playback on the default device.
 func StopPlayer() error {
-	log.Println("Stopping playback")
-	return SendMPVCommand(`{ "command": ["stop"] }`)
+	return playbackServer.Default().Stop()
+}
+
+// trackClient marks ip as having made a request just now, for /stats/listeners.
+func trackClient(ip string) {
+	clientsMutex.Lock()
+	defer clientsMutex.Unlock()
+	clientSeen[ip] = time.Now()
+}
+
+// activeClients returns the IPs that have made a request within clientWindow,
+// pruning any that have aged out.
+func activeClients() []string {
+	clientsMutex.Lock()
+	defer clientsMutex.Unlock()
+	cutoff := time.Now().Add(-clientWindow)
+	active := []string{}
+	for ip, seen := range clientSeen {
+		if seen.Before(cutoff) {
+			delete(clientSeen, ip)
+			continue
+		}
+		active = append(active, ip)
+	}
+	return active
 }
 
 // StartGamepadListener starts listening for gamepad events
@@ -281,7 +267,7 @@ func processGamepadEvent(event JoystickEvent) {
 	var err error
 	switch event.Number {
 	case config.ButtonMappings.Play:
-		err = StartMPV(stations[currentIdx].URL)
+		err = StartMPV(playbackServer.Default().Station().URL)
 	case config.ButtonMappings.Next:
 		err = PlayNextStation()
 	case config.ButtonMappings.Previous:
@@ -299,27 +285,99 @@ func processGamepadEvent(event JoystickEvent) {
 	}
 }
 
+// DeviceStatus is the JSON shape returned by GET /devices.
+type DeviceStatus struct {
+	Name        string  `json:"name"`
+	AudioDevice string  `json:"audio_device,omitempty"`
+	Default     bool    `json:"default"`
+	Station     string  `json:"station"`
+	Volume      int     `json:"volume"`
+	Gain        float64 `json:"gain"`
+	Muted       bool    `json:"muted"`
+}
+
+func deviceStatuses() []DeviceStatus {
+	devices := playbackServer.All()
+	out := make([]DeviceStatus, len(devices))
+	for i, d := range devices {
+		out[i] = DeviceStatus{
+			Name:        d.Name,
+			AudioDevice: d.AudioDevice,
+			Default:     d.IsDefault,
+			Station:     d.Station().Name,
+			Volume:      d.Volume(),
+			Gain:        d.Gain(),
+			Muted:       d.Muted(),
+		}
+	}
+	return out
+}
+
+// withDevice looks up the :name device for a /devices/:name/... route and
+// runs fn against it, replying 404 if no such device exists.
+func withDevice(c *gin.Context, fn func(*PlaybackDevice) error) {
+	d, ok := playbackServer.Get(c.Param("name"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no such device"})
+		return
+	}
+	if err := fn(d); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "ok"})
+}
+
 func setupServer() *gin.Engine {
 	r := gin.Default()
 
+	r.Use(func(c *gin.Context) {
+		trackClient(c.ClientIP())
+		c.Next()
+	})
+
 	// Add version endpoint
 	r.GET("/version", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"version": version})
 	})
 
 	r.GET("/stations", func(c *gin.Context) {
-		c.JSON(http.StatusOK, stations)
+		c.JSON(http.StatusOK, getStations())
+	})
+
+	r.POST("/stations/refresh", func(c *gin.Context) {
+		if err := loadStations(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("Loaded %d stations", len(getStations()))})
+	})
+
+	r.GET("/stations/search", func(c *gin.Context) {
+		q := strings.ToLower(strings.TrimSpace(c.Query("q")))
+		current := getStations()
+		if q == "" {
+			c.JSON(http.StatusOK, current)
+			return
+		}
+		matches := []RadioStation{}
+		for _, s := range current {
+			if strings.Contains(strings.ToLower(s.Name), q) {
+				matches = append(matches, s)
+			}
+		}
+		c.JSON(http.StatusOK, matches)
 	})
 
 	r.GET("/status", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{
-			"current_station": stations[currentIdx].Name,
-			"volume":          currentVol,
+			"current_station": playbackServer.Default().Station().Name,
+			"volume":          playbackServer.Default().Volume(),
 		})
 	})
 
 	r.POST("/play", func(c *gin.Context) {
-		if err := StartMPV(stations[currentIdx].URL); err != nil {
+		if err := StartMPV(playbackServer.Default().Station().URL); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
@@ -331,7 +389,7 @@ func setupServer() *gin.Engine {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
-		c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("Playing: %s", stations[currentIdx].Name)})
+		c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("Playing: %s", playbackServer.Default().Station().Name)})
 	})
 
 	r.POST("/prev", func(c *gin.Context) {
@@ -339,7 +397,7 @@ func setupServer() *gin.Engine {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
-		c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("Playing: %s", stations[currentIdx].Name)})
+		c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("Playing: %s", playbackServer.Default().Station().Name)})
 	})
 
 	r.POST("/stop", func(c *gin.Context) {
@@ -355,7 +413,7 @@ func setupServer() *gin.Engine {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
-		c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("Volume: %d", currentVol)})
+		c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("Volume: %d", playbackServer.Default().Volume())})
 	})
 
 	r.POST("/voldown", func(c *gin.Context) {
@@ -363,7 +421,106 @@ func setupServer() *gin.Engine {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
-		c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("Volume: %d", currentVol)})
+		c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("Volume: %d", playbackServer.Default().Volume())})
+	})
+
+	r.GET("/devices", func(c *gin.Context) {
+		c.JSON(http.StatusOK, deviceStatuses())
+	})
+
+	r.POST("/devices/:name/play", func(c *gin.Context) {
+		withDevice(c, func(d *PlaybackDevice) error { return d.Start(d.Station().URL) })
+	})
+
+	r.POST("/devices/:name/next", func(c *gin.Context) {
+		withDevice(c, func(d *PlaybackDevice) error { return d.Next() })
+	})
+
+	r.POST("/devices/:name/prev", func(c *gin.Context) {
+		withDevice(c, func(d *PlaybackDevice) error { return d.Prev() })
+	})
+
+	r.POST("/devices/:name/stop", func(c *gin.Context) {
+		withDevice(c, func(d *PlaybackDevice) error { return d.Stop() })
+	})
+
+	r.POST("/devices/:name/vol", func(c *gin.Context) {
+		var body struct {
+			Volume *int     `json:"volume"`
+			Gain   *float64 `json:"gain"`
+			Muted  *bool    `json:"muted"`
+		}
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		withDevice(c, func(d *PlaybackDevice) error {
+			if body.Volume != nil {
+				if err := d.SetVolume(*body.Volume); err != nil {
+					return err
+				}
+			}
+			if body.Gain != nil {
+				if err := d.SetGain(*body.Gain); err != nil {
+					return err
+				}
+			}
+			if body.Muted != nil {
+				if err := d.SetMuted(*body.Muted); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+
+	r.GET("/history", func(c *gin.Context) {
+		if statsStore == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "stats database not available"})
+			return
+		}
+		limit := 20
+		if l, err := strconv.Atoi(c.Query("limit")); err == nil && l > 0 {
+			limit = l
+		}
+		history, err := statsStore.History(limit)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, history)
+	})
+
+	r.GET("/stats/top", func(c *gin.Context) {
+		if statsStore == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "stats database not available"})
+			return
+		}
+		since := time.Now().Add(-7 * 24 * time.Hour)
+		if s := c.Query("since"); s != "" {
+			if t, err := time.Parse(time.RFC3339, s); err == nil {
+				since = t
+			}
+		}
+		top, err := statsStore.TopStations(since)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, top)
+	})
+
+	r.GET("/stats/listeners", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"listeners": activeClients()})
+	})
+
+	r.GET("/nowplaying", func(c *gin.Context) {
+		title, artist := currentNowPlaying()
+		c.JSON(http.StatusOK, gin.H{
+			"station": playbackServer.Default().Station().Name,
+			"title":   title,
+			"artist":  artist,
+		})
 	})
 
 	return r
@@ -378,10 +535,19 @@ func main() {
 	gamepadDevice := flag.String("gamepad", "", "Gamepad device path (overrides config file)")
 	stationsAPI := flag.String("api", "", "Stations API URL (overrides config file)")
 	socketPath := flag.String("socket", "/tmp/mpv-socket", "MPV socket path")
+	controlSocketPath := flag.String("control-socket", defaultControlSocket, "Control socket path for -send")
+	replace := flag.Bool("replace", false, "Take over from an already-running instance")
+	send := flag.String("send", "", "Send a command to the running instance and exit: next|prev|toggle|stop|volup|voldown|list|status")
 	flag.Parse()
 
-	// Update MPV socket path
-	mpvSocket = *socketPath
+	// In -send mode we're just a CLI client for the running daemon: talk to
+	// its control socket and exit without touching mpv or the HTTP server.
+	if *send != "" {
+		if err := sendControlCommand(*controlSocketPath, *send); err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		return
+	}
 
 	// Load configuration
 	if err := LoadConfig(*configPath); err != nil {
@@ -399,14 +565,46 @@ func main() {
 		config.StationsAPIURL = *stationsAPI
 	}
 
-	// Fetch radio stations
-	var err error
-	stations, err = FetchRadioStations(config.StationsAPIURL)
-	if err != nil {
-		log.Fatalf("Failed to fetch radio stations: %v", err)
+	// Fetch radio stations from every configured source
+	if err := loadStations(); err != nil {
+		log.Fatalf("Failed to load radio stations: %v", err)
 	}
 	log.Printf("Loaded %d radio stations\n", len(stations))
 
+	// Build playback devices from config.Devices, falling back to a single
+	// implicit default device using -socket so plain single-zone setups keep
+	// working without a config change.
+	deviceConfigs := config.Devices
+	if len(deviceConfigs) == 0 {
+		deviceConfigs = []DeviceConfig{{Name: "default", Default: true}}
+	}
+	for _, dc := range deviceConfigs {
+		path := deviceSocketPath(dc.Name)
+		if dc.Name == "default" {
+			path = *socketPath
+		}
+		playbackServer.Add(newPlaybackDevice(dc, path))
+	}
+	log.Printf("Configured %d playback device(s)\n", len(deviceConfigs))
+
+	// Bind the single-instance control socket so `radioctr -send ...` can
+	// script this daemon and so a second instance never fights this one
+	// over the mpv IPC socket.
+	ctrlListener, err := acquireControlSocket(*controlSocketPath, *replace)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	go runControlServer(ctrlListener)
+
+	// Open the listening-history database; stats are best-effort and don't
+	// block the daemon from starting if this fails.
+	statsStore, err = stats.Open(config.StatsDBPath)
+	if err != nil {
+		log.Printf("Warning: couldn't open stats database: %v", err)
+	} else {
+		defer statsStore.Close()
+	}
+
 	// Setup signal handling for graceful shutdown
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
@@ -421,10 +619,30 @@ func main() {
 		}
 	}()
 
+	// Register as an MPRIS2 player so desktop environments and media keys
+	// can control playback; this is best-effort and non-fatal without a
+	// session bus (e.g. headless setups).
+	if err := StartMPRIS(); err != nil {
+		log.Printf("MPRIS2 registration skipped: %v\n", err)
+	}
+
 	// Setup and start HTTP server
 	r := setupServer()
 	log.Printf("Server starting on port %s\n", config.ServerPort)
-	if err := r.Run(":" + config.ServerPort); err != nil {
-		log.Fatalf("Server failed to start: %v", err)
+	go func() {
+		if err := r.Run(":" + config.ServerPort); err != nil {
+			log.Fatalf("Server failed to start: %v", err)
+		}
+	}()
+
+	// Wait for a shutdown signal - either the OS asking us to stop, or
+	// another instance taking over via -replace - then tear down every
+	// device's mpv process so none are left orphaned.
+	select {
+	case sig := <-sigChan:
+		log.Printf("Received signal %v, shutting down\n", sig)
+	case <-shutdownChan:
+		log.Println("Shutting down (replaced by another instance)")
 	}
+	playbackServer.Shutdown()
 }
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/introspect"
+	"github.com/godbus/dbus/v5/prop"
+)
+
+const (
+	mprisObjectPath  = dbus.ObjectPath("/org/mpris/MediaPlayer2")
+	mprisBusName     = "org.mpris.MediaPlayer2.radioctr"
+	mprisRootIface   = "org.mpris.MediaPlayer2"
+	mprisPlayerIface = "org.mpris.MediaPlayer2.Player"
+)
+
+// mprisConn is the shared session bus connection used to publish the player,
+// or nil if MPRIS registration failed or wasn't attempted (e.g. no bus).
+var (
+	mprisConn  *dbus.Conn
+	mprisProps *prop.Properties
+)
+
+// mprisRoot implements the org.mpris.MediaPlayer2 root interface.
+type mprisRoot struct{}
+
+func (mprisRoot) Raise() *dbus.Error { return nil }
+
+func (mprisRoot) Quit() *dbus.Error { return nil }
+
+// mprisPlayer implements org.mpris.MediaPlayer2.Player by delegating to the
+// same functions the HTTP and gamepad control paths use.
+type mprisPlayer struct{}
+
+func (mprisPlayer) Play() *dbus.Error {
+	if err := StartMPV(playbackServer.Default().Station().URL); err != nil {
+		return dbus.MakeFailedError(err)
+	}
+	return nil
+}
+
+func (mprisPlayer) Pause() *dbus.Error {
+	client := playbackServer.Default().Client()
+	if client == nil {
+		return dbus.MakeFailedError(fmt.Errorf("mpv is not running"))
+	}
+	if _, err := client.Command("set_property", "pause", true); err != nil {
+		return dbus.MakeFailedError(err)
+	}
+	return nil
+}
+
+func (mprisPlayer) PlayPause() *dbus.Error {
+	client := playbackServer.Default().Client()
+	if client == nil {
+		return dbus.MakeFailedError(fmt.Errorf("mpv is not running"))
+	}
+	if _, err := client.Command("cycle", "pause"); err != nil {
+		return dbus.MakeFailedError(err)
+	}
+	return nil
+}
+
+func (mprisPlayer) Stop() *dbus.Error {
+	if err := StopPlayer(); err != nil {
+		return dbus.MakeFailedError(err)
+	}
+	return nil
+}
+
+func (mprisPlayer) Next() *dbus.Error {
+	if err := PlayNextStation(); err != nil {
+		return dbus.MakeFailedError(err)
+	}
+	return nil
+}
+
+func (mprisPlayer) Previous() *dbus.Error {
+	if err := PlayPrevStation(); err != nil {
+		return dbus.MakeFailedError(err)
+	}
+	return nil
+}
+
+// StartMPRIS connects to the session bus and registers radioctr as an
+// org.mpris.MediaPlayer2 player, so desktop environments and hardware media
+// keys can drive it the same way the gamepad listener and HTTP endpoints do.
+func StartMPRIS() error {
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return err
+	}
+
+	reply, err := conn.RequestName(mprisBusName, dbus.NameFlagDoNotQueue)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	if reply != dbus.RequestNameReplyPrimaryOwner {
+		conn.Close()
+		return fmt.Errorf("MPRIS bus name %s already taken", mprisBusName)
+	}
+
+	conn.Export(mprisRoot{}, mprisObjectPath, mprisRootIface)
+	conn.Export(mprisPlayer{}, mprisObjectPath, mprisPlayerIface)
+
+	propsSpec := prop.Map{
+		mprisRootIface: {
+			"Identity":            {Value: "radioctr", Writable: false, Emit: prop.EmitFalse},
+			"CanQuit":             {Value: false, Writable: false, Emit: prop.EmitFalse},
+			"CanRaise":            {Value: false, Writable: false, Emit: prop.EmitFalse},
+			"HasTrackList":        {Value: false, Writable: false, Emit: prop.EmitFalse},
+			"SupportedUriSchemes": {Value: []string{"http", "https"}, Writable: false, Emit: prop.EmitFalse},
+			"SupportedMimeTypes":  {Value: []string{}, Writable: false, Emit: prop.EmitFalse},
+		},
+		mprisPlayerIface: {
+			"PlaybackStatus": {Value: "Playing", Writable: false, Emit: prop.EmitTrue},
+			"Metadata":       {Value: mprisMetadata(), Writable: false, Emit: prop.EmitTrue},
+			"Volume":         {Value: mprisVolume(), Writable: true, Emit: prop.EmitTrue, Callback: mprisVolumeSet},
+			"CanGoNext":      {Value: true, Writable: false, Emit: prop.EmitFalse},
+			"CanGoPrevious":  {Value: true, Writable: false, Emit: prop.EmitFalse},
+			"CanPlay":        {Value: true, Writable: false, Emit: prop.EmitFalse},
+			"CanPause":       {Value: true, Writable: false, Emit: prop.EmitFalse},
+			"CanSeek":        {Value: false, Writable: false, Emit: prop.EmitFalse},
+			"CanControl":     {Value: true, Writable: false, Emit: prop.EmitFalse},
+		},
+	}
+	mprisProps = prop.New(conn, mprisObjectPath, propsSpec)
+
+	node := &introspect.Node{
+		Name: string(mprisObjectPath),
+		Interfaces: []introspect.Interface{
+			introspect.IntrospectData,
+			prop.IntrospectData,
+			{
+				Name: mprisRootIface,
+				Methods: []introspect.Method{
+					{Name: "Raise"},
+					{Name: "Quit"},
+				},
+			},
+			{
+				Name: mprisPlayerIface,
+				Methods: []introspect.Method{
+					{Name: "Play"},
+					{Name: "Pause"},
+					{Name: "PlayPause"},
+					{Name: "Stop"},
+					{Name: "Next"},
+					{Name: "Previous"},
+				},
+			},
+		},
+	}
+	conn.Export(introspect.NewIntrospectable(node), mprisObjectPath, "org.freedesktop.DBus.Introspectable")
+
+	mprisConn = conn
+	log.Printf("MPRIS2 player registered as %s\n", mprisBusName)
+	return nil
+}
+
+// mprisVolumeSet handles MPRIS clients setting Volume directly (e.g. a
+// desktop volume slider) by routing it through AdjustVolume.
+func mprisVolumeSet(c *prop.Change) *dbus.Error {
+	vol, ok := c.Value.(float64)
+	if !ok {
+		return prop.ErrInvalidArg
+	}
+	if err := AdjustVolume(int(vol*100) - playbackServer.Default().Volume()); err != nil {
+		return dbus.MakeFailedError(err)
+	}
+	return nil
+}
+
+func mprisVolume() float64 {
+	return float64(playbackServer.Default().Volume()) / 100.0
+}
+
+func mprisMetadata() map[string]dbus.Variant {
+	md := map[string]dbus.Variant{
+		"mpris:trackid": dbus.MakeVariant(dbus.ObjectPath("/org/mpris/MediaPlayer2/radioctr/NoTrack")),
+	}
+	if len(getStations()) > 0 {
+		station := playbackServer.Default().Station()
+		md["xesam:title"] = dbus.MakeVariant(station.Name)
+		md["xesam:url"] = dbus.MakeVariant(station.URL)
+	}
+	return md
+}
+
+// mprisNotifyStationChanged emits PropertiesChanged for Metadata, and for
+// PlaybackStatus when playing is true; call it whenever currentIdx changes,
+// whether the change came from HTTP, the gamepad, or MPRIS itself. Pass
+// playing=false when the station switch's mpv launch failed, so clients
+// aren't told playback is active when it never started.
+func mprisNotifyStationChanged(playing bool) {
+	if mprisProps == nil {
+		return
+	}
+	mprisProps.SetMust(mprisPlayerIface, "Metadata", mprisMetadata())
+	if playing {
+		mprisProps.SetMust(mprisPlayerIface, "PlaybackStatus", "Playing")
+	}
+}
+
+// mprisNotifyVolumeChanged emits PropertiesChanged for Volume; call it
+// whenever currentVol changes, whether the change came from HTTP, the
+// gamepad, or MPRIS itself.
+func mprisNotifyVolumeChanged() {
+	if mprisProps == nil {
+		return
+	}
+	mprisProps.SetMust(mprisPlayerIface, "Volume", mprisVolume())
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// MPVEvent is a notification pushed by mpv over its IPC socket, e.g.
+// "playback-restart", "end-file", "metadata-update", or "pause".
+type MPVEvent struct {
+	Name string
+	Data map[string]interface{}
+}
+
+// mpvResponse is mpv's reply to a command we sent, matched back to the
+// caller by RequestID.
+type mpvResponse struct {
+	RequestID int64           `json:"request_id"`
+	Error     string          `json:"error"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// MPVClient is a long-lived connection to mpv's JSON IPC socket. It assigns
+// a request_id to every command so replies can be demultiplexed back to the
+// caller, and fans out unsolicited "event" messages so callers can react to
+// stream state changes instead of polling.
+type MPVClient struct {
+	conn   net.Conn
+	nextID int64
+
+	mu      sync.Mutex
+	pending map[int64]chan mpvResponse
+	closed  bool
+
+	waitersMu sync.Mutex
+	waiters   map[string][]chan struct{}
+
+	// OnDisconnect, if set, is called once when the IPC connection is lost
+	// unexpectedly (i.e. not via Close), so callers can reconnect/retry
+	// instead of leaving mpv idle.
+	OnDisconnect func()
+
+	// OnEvent, if set, is called for every unsolicited event mpv sends. It's
+	// set per-device so handlers know which PlaybackDevice raised the event.
+	OnEvent func(MPVEvent)
+}
+
+// DialMPV connects to mpv's Unix-socket IPC server at socketPath and starts
+// a background reader that demultiplexes replies and dispatches events.
+// onEvent/onDisconnect are wired up before the reader goroutine launches, so
+// callers must pass them in here rather than assigning OnEvent/OnDisconnect
+// afterward - setting them post-return races the reader goroutine's reads.
+func DialMPV(socketPath string, onEvent func(MPVEvent), onDisconnect func()) (*MPVClient, error) {
+	conn, err := net.Dial("unix", socketPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to mpv socket: %v", err)
+	}
+
+	c := &MPVClient{
+		conn:         conn,
+		pending:      make(map[int64]chan mpvResponse),
+		waiters:      make(map[string][]chan struct{}),
+		OnEvent:      onEvent,
+		OnDisconnect: onDisconnect,
+	}
+	go c.readLoop()
+	return c, nil
+}
+
+// Close shuts down the IPC connection. It does not trigger OnDisconnect.
+func (c *MPVClient) Close() error {
+	c.mu.Lock()
+	c.closed = true
+	c.mu.Unlock()
+	return c.conn.Close()
+}
+
+// Command sends a command to mpv and blocks until the matching reply
+// arrives, timing out after 5 seconds.
+func (c *MPVClient) Command(args ...interface{}) (json.RawMessage, error) {
+	id := atomic.AddInt64(&c.nextID, 1)
+	reply := make(chan mpvResponse, 1)
+
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil, fmt.Errorf("mpv IPC connection is closed")
+	}
+	c.pending[id] = reply
+	c.mu.Unlock()
+
+	payload, err := json.Marshal(struct {
+		Command   []interface{} `json:"command"`
+		RequestID int64         `json:"request_id"`
+	}{Command: args, RequestID: id})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode mpv command: %v", err)
+	}
+
+	if _, err := c.conn.Write(append(payload, '\n')); err != nil {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+		return nil, fmt.Errorf("failed to write to mpv socket: %v", err)
+	}
+
+	select {
+	case resp := <-reply:
+		if resp.Error != "success" && resp.Error != "" {
+			return nil, fmt.Errorf("mpv error: %s", resp.Error)
+		}
+		return resp.Data, nil
+	case <-time.After(5 * time.Second):
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+		return nil, fmt.Errorf("timed out waiting for mpv reply")
+	}
+}
+
+// WaitForEvent blocks until mpv emits an event named name, or timeout
+// elapses.
+func (c *MPVClient) WaitForEvent(name string, timeout time.Duration) error {
+	ch := make(chan struct{})
+	c.waitersMu.Lock()
+	c.waiters[name] = append(c.waiters[name], ch)
+	c.waitersMu.Unlock()
+
+	select {
+	case <-ch:
+		return nil
+	case <-time.After(timeout):
+		return fmt.Errorf("timed out waiting for mpv event %q", name)
+	}
+}
+
+func (c *MPVClient) notifyWaiters(name string) {
+	c.waitersMu.Lock()
+	waiters := c.waiters[name]
+	delete(c.waiters, name)
+	c.waitersMu.Unlock()
+
+	for _, ch := range waiters {
+		close(ch)
+	}
+}
+
+// readLoop demultiplexes mpv's newline-delimited JSON messages: replies
+// (carrying request_id) are routed to the pending Command call, everything
+// else is treated as an event and dispatched to onEvent/waiters.
+func (c *MPVClient) readLoop() {
+	scanner := bufio.NewScanner(c.conn)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+
+		var generic map[string]interface{}
+		if err := json.Unmarshal(line, &generic); err != nil {
+			continue
+		}
+
+		if _, ok := generic["request_id"]; ok {
+			var resp mpvResponse
+			if err := json.Unmarshal(line, &resp); err != nil {
+				continue
+			}
+			c.mu.Lock()
+			ch, ok := c.pending[resp.RequestID]
+			if ok {
+				delete(c.pending, resp.RequestID)
+			}
+			c.mu.Unlock()
+			if ok {
+				ch <- resp
+			}
+			continue
+		}
+
+		if name, ok := generic["event"].(string); ok {
+			evt := MPVEvent{Name: name, Data: generic}
+			if c.OnEvent != nil {
+				c.OnEvent(evt)
+			}
+			c.notifyWaiters(name)
+		}
+	}
+
+	c.mu.Lock()
+	wasClosed := c.closed
+	c.closed = true
+	c.mu.Unlock()
+
+	if !wasClosed && c.OnDisconnect != nil {
+		c.OnDisconnect()
+	}
+}
+
+// onMPVEvent reacts to mpv IPC events that matter beyond one-shot waiters:
+// it keeps the /nowplaying metadata and MPRIS PlaybackStatus fresh. Both are
+// single shared values representing the default zone, so non-default
+// devices' events are ignored here.
+func (d *PlaybackDevice) onMPVEvent(evt MPVEvent) {
+	if !d.IsDefault {
+		return
+	}
+	switch evt.Name {
+	case "metadata-update":
+		// Run off the reader goroutine: refreshNowPlaying waits for a
+		// Command reply, which only readLoop can deliver.
+		go refreshNowPlaying()
+	case "pause", "unpause":
+		if mprisProps != nil {
+			status := "Playing"
+			if evt.Name == "pause" {
+				status = "Paused"
+			}
+			mprisProps.SetMust(mprisPlayerIface, "PlaybackStatus", status)
+		}
+	}
+}
+
+// nowPlaying holds the most recently observed ICY/stream metadata, surfaced
+// through GET /nowplaying.
+var (
+	nowPlayingMu     sync.Mutex
+	nowPlayingTitle  string
+	nowPlayingArtist string
+)
+
+// refreshNowPlaying asks mpv for the current stream metadata and updates the
+// cached title/artist used by GET /nowplaying.
+func refreshNowPlaying() {
+	client := playbackServer.Default().Client()
+	if client == nil {
+		return
+	}
+	data, err := client.Command("get_property", "metadata")
+	if err != nil {
+		log.Printf("Warning: couldn't fetch stream metadata: %v", err)
+		return
+	}
+
+	var meta struct {
+		Title  string `json:"icy-title"`
+		Artist string `json:"icy-artist"`
+	}
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return
+	}
+
+	nowPlayingMu.Lock()
+	nowPlayingTitle = meta.Title
+	nowPlayingArtist = meta.Artist
+	nowPlayingMu.Unlock()
+}
+
+// currentNowPlaying returns the cached title/artist for GET /nowplaying.
+func currentNowPlaying() (title, artist string) {
+	nowPlayingMu.Lock()
+	defer nowPlayingMu.Unlock()
+	return nowPlayingTitle, nowPlayingArtist
+}
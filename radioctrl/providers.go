@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// SourceSpec configures one station source in Config.StationSources. Type
+// selects which StationProvider handles it; the remaining fields are
+// interpreted according to Type.
+type SourceSpec struct {
+	Type     string `json:"type"` // "http", "m3u", or "radiobrowser"
+	URL      string `json:"url,omitempty"`
+	Path     string `json:"path,omitempty"`
+	Country  string `json:"country,omitempty"`
+	Tag      string `json:"tag,omitempty"`
+	Language string `json:"language,omitempty"`
+	Limit    int    `json:"limit,omitempty"`
+}
+
+// StationProvider supplies a list of radio stations from some source, so
+// the daemon isn't limited to a single hard-coded API.
+type StationProvider interface {
+	Fetch() ([]RadioStation, error)
+}
+
+// NewStationProvider builds the StationProvider described by spec.
+func NewStationProvider(spec SourceSpec) (StationProvider, error) {
+	switch spec.Type {
+	case "", "http":
+		if spec.URL == "" {
+			return nil, fmt.Errorf("http station source is missing a url")
+		}
+		return httpProvider{apiURL: spec.URL}, nil
+	case "m3u":
+		if spec.Path == "" {
+			return nil, fmt.Errorf("m3u station source is missing a path")
+		}
+		return m3uProvider{path: spec.Path}, nil
+	case "radiobrowser":
+		return radioBrowserProvider{
+			country:  spec.Country,
+			tag:      spec.Tag,
+			language: spec.Language,
+			limit:    spec.Limit,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown station source type %q", spec.Type)
+	}
+}
+
+// httpProvider fetches stations from a JSON API, e.g. the default
+// Cloudflare Worker URL.
+type httpProvider struct {
+	apiURL string
+}
+
+func (p httpProvider) Fetch() ([]RadioStation, error) {
+	return FetchRadioStations(p.apiURL)
+}
+
+// m3uProvider loads stations from a local M3U/M3U8 or PLS playlist file.
+type m3uProvider struct {
+	path string
+}
+
+func (p m3uProvider) Fetch() ([]RadioStation, error) {
+	f, err := os.Open(p.path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening playlist %s: %v", p.path, err)
+	}
+	defer f.Close()
+
+	if strings.HasSuffix(strings.ToLower(p.path), ".pls") {
+		return parsePLS(f)
+	}
+	return parseM3U(f)
+}
+
+// parseM3U reads #EXTM3U-style playlists, pairing each #EXTINF title with
+// the stream URL on the following non-comment line.
+func parseM3U(r io.Reader) ([]RadioStation, error) {
+	var stations []RadioStation
+	scanner := bufio.NewScanner(r)
+
+	pendingName := ""
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "#EXTINF:") {
+			if idx := strings.Index(line, ","); idx != -1 {
+				pendingName = strings.TrimSpace(line[idx+1:])
+			}
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		name := pendingName
+		if name == "" {
+			name = line
+		}
+		stations = append(stations, RadioStation{Name: name, URL: line})
+		pendingName = ""
+	}
+	return stations, scanner.Err()
+}
+
+// parsePLS reads [playlist]-style playlists, pairing each FileN= URL with
+// its matching TitleN= name.
+func parsePLS(r io.Reader) ([]RadioStation, error) {
+	files := map[string]string{}
+	titles := map[string]string{}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(key, "File"):
+			files[strings.TrimPrefix(key, "File")] = value
+		case strings.HasPrefix(key, "Title"):
+			titles[strings.TrimPrefix(key, "Title")] = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	stations := make([]RadioStation, 0, len(files))
+	for n, u := range files {
+		name := titles[n]
+		if name == "" {
+			name = u
+		}
+		stations = append(stations, RadioStation{Name: name, URL: u})
+	}
+	return stations, nil
+}
+
+// radioBrowserAPI is the default radio-browser.info mirror queried by
+// radioBrowserProvider.
+const radioBrowserAPI = "https://de1.api.radio-browser.info"
+
+// radioBrowserProvider queries radio-browser.info's public directory by
+// country/tag/language, most-clicked stations first. Fetch registers no
+// clicks; that happens in registerRadioBrowserClick once a station is tuned
+// into.
+type radioBrowserProvider struct {
+	country  string
+	tag      string
+	language string
+	limit    int
+}
+
+type radioBrowserStation struct {
+	StationUUID string `json:"stationuuid"`
+	Name        string `json:"name"`
+	URL         string `json:"url"`
+	URLResolved string `json:"url_resolved"`
+}
+
+func (p radioBrowserProvider) Fetch() ([]RadioStation, error) {
+	q := url.Values{}
+	if p.country != "" {
+		q.Set("country", p.country)
+	}
+	if p.tag != "" {
+		q.Set("tag", p.tag)
+	}
+	if p.language != "" {
+		q.Set("language", p.language)
+	}
+	limit := p.limit
+	if limit <= 0 {
+		limit = 100
+	}
+	q.Set("limit", fmt.Sprintf("%d", limit))
+	q.Set("order", "clickcount")
+	q.Set("reverse", "true")
+
+	client := &http.Client{Timeout: 20 * time.Second}
+	resp, err := client.Get(radioBrowserAPI + "/json/stations/search?" + q.Encode())
+	if err != nil {
+		return nil, fmt.Errorf("error querying radio-browser.info: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw []radioBrowserStation
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, fmt.Errorf("error parsing radio-browser.info response: %v", err)
+	}
+
+	stations := make([]RadioStation, 0, len(raw))
+	for _, s := range raw {
+		streamURL := s.URLResolved
+		if streamURL == "" {
+			streamURL = s.URL
+		}
+		if streamURL == "" {
+			continue
+		}
+		stations = append(stations, RadioStation{Name: s.Name, URL: streamURL, StationUUID: s.StationUUID})
+	}
+	return stations, nil
+}
+
+// registerRadioBrowserClick tells radio-browser.info a station was actually
+// tuned into, contributing to its community click-count ranking. Called
+// from PlaybackDevice.recordListenStart, not the list-fetch path, so a
+// directory query doesn't bulk-increment every result's click count.
+// Best-effort: failures are logged, never surfaced to the caller.
+func registerRadioBrowserClick(stationUUID string) {
+	if stationUUID == "" {
+		return
+	}
+	client := &http.Client{
+		Timeout: 5 * time.Second,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+	}
+	resp, err := client.Get(radioBrowserAPI + "/json/url/" + stationUUID)
+	if err != nil {
+		log.Printf("Warning: couldn't register radio-browser.info click for %s: %v\n", stationUUID, err)
+		return
+	}
+	resp.Body.Close()
+}
+
+// mergeStations concatenates stations from every source, de-duplicating by
+// URL so the same stream listed by two providers only appears once.
+func mergeStations(lists ...[]RadioStation) []RadioStation {
+	seen := make(map[string]bool)
+	merged := []RadioStation{}
+	for _, list := range lists {
+		for _, s := range list {
+			if seen[s.URL] {
+				continue
+			}
+			seen[s.URL] = true
+			merged = append(merged, s)
+		}
+	}
+	return merged
+}
+
+// loadStations runs every configured station source and merges the
+// results into the global stations list. Each source is best-effort: one
+// failing provider logs a warning instead of failing the whole refresh.
+func loadStations() error {
+	sources := config.StationSources
+	if len(sources) == 0 {
+		sources = []SourceSpec{{Type: "http", URL: config.StationsAPIURL}}
+	}
+
+	var lists [][]RadioStation
+	for _, spec := range sources {
+		provider, err := NewStationProvider(spec)
+		if err != nil {
+			log.Printf("Warning: skipping station source: %v\n", err)
+			continue
+		}
+		fetched, err := provider.Fetch()
+		if err != nil {
+			log.Printf("Warning: station source %s failed: %v\n", spec.Type, err)
+			continue
+		}
+		lists = append(lists, fetched)
+	}
+
+	merged := mergeStations(lists...)
+	if len(merged) == 0 {
+		return fmt.Errorf("no stations available from any configured source")
+	}
+	setStations(merged)
+	return nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseM3U(t *testing.T) {
+	input := `#EXTM3U
+#EXTINF:-1,Station One
+http://example.com/one.mp3
+#EXTINF:-1,Station Two
+http://example.com/two.mp3
+http://example.com/three.mp3
+`
+	stations, err := parseM3U(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parseM3U returned error: %v", err)
+	}
+
+	want := []RadioStation{
+		{Name: "Station One", URL: "http://example.com/one.mp3"},
+		{Name: "Station Two", URL: "http://example.com/two.mp3"},
+		{Name: "http://example.com/three.mp3", URL: "http://example.com/three.mp3"},
+	}
+	if len(stations) != len(want) {
+		t.Fatalf("got %d stations, want %d: %+v", len(stations), len(want), stations)
+	}
+	for i, s := range stations {
+		if s != want[i] {
+			t.Errorf("station %d = %+v, want %+v", i, s, want[i])
+		}
+	}
+}
+
+func TestParsePLS(t *testing.T) {
+	input := `[playlist]
+File1=http://example.com/one.mp3
+Title1=Station One
+File2=http://example.com/two.mp3
+NumberOfEntries=2
+`
+	stations, err := parsePLS(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parsePLS returned error: %v", err)
+	}
+	if len(stations) != 2 {
+		t.Fatalf("got %d stations, want 2: %+v", len(stations), stations)
+	}
+
+	byURL := map[string]RadioStation{}
+	for _, s := range stations {
+		byURL[s.URL] = s
+	}
+
+	if s, ok := byURL["http://example.com/one.mp3"]; !ok || s.Name != "Station One" {
+		t.Errorf("entry 1 = %+v, want Name %q", s, "Station One")
+	}
+	if s, ok := byURL["http://example.com/two.mp3"]; !ok || s.Name != "http://example.com/two.mp3" {
+		t.Errorf("entry 2 without a title should fall back to its URL as Name, got %+v", s)
+	}
+}
+
+func TestMergeStations(t *testing.T) {
+	a := []RadioStation{
+		{Name: "A", URL: "http://example.com/a.mp3"},
+		{Name: "B", URL: "http://example.com/b.mp3"},
+	}
+	b := []RadioStation{
+		{Name: "B dup", URL: "http://example.com/b.mp3"},
+		{Name: "C", URL: "http://example.com/c.mp3"},
+	}
+
+	merged := mergeStations(a, b)
+
+	wantURLs := []string{
+		"http://example.com/a.mp3",
+		"http://example.com/b.mp3",
+		"http://example.com/c.mp3",
+	}
+	if len(merged) != len(wantURLs) {
+		t.Fatalf("got %d stations, want %d: %+v", len(merged), len(wantURLs), merged)
+	}
+	for i, url := range wantURLs {
+		if merged[i].URL != url {
+			t.Errorf("merged[%d].URL = %q, want %q", i, merged[i].URL, url)
+		}
+	}
+	// The first list's entry for a duplicate URL wins.
+	if merged[1].Name != "B" {
+		t.Errorf("merged[1].Name = %q, want %q (first occurrence should win)", merged[1].Name, "B")
+	}
+}